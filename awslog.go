@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/smithy-go/logging"
+)
+
+// awsLogAdapter lets the AWS SDK's own request/retry logging flow through
+// our slog.Logger instead of writing directly to stderr, so exporter logs
+// and SDK logs share one format and one --log.level/--log.format.
+type awsLogAdapter struct {
+	logger *slog.Logger
+}
+
+// Logf implements logging.Logger.
+func (a awsLogAdapter) Logf(classification logging.Classification, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if classification == logging.Warn {
+		a.logger.Warn(msg)
+		return
+	}
+	a.logger.Debug(msg)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// clientCache hands out *cloudwatch.Client instances keyed by
+// region+role_arn, reusing one for clientCacheTTL so a busy /probe endpoint
+// doesn't re-assume a role (or rebuild a client) on every scrape.
+type clientCache struct {
+	base aws.Config
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedClient
+}
+
+type cachedClient struct {
+	client    *cloudwatch.Client
+	expiresAt time.Time
+}
+
+func newClientCache(base aws.Config, ttl time.Duration) *clientCache {
+	return &clientCache{
+		base:    base,
+		ttl:     ttl,
+		entries: make(map[string]cachedClient),
+	}
+}
+
+// get returns a CloudWatch client for region, optionally assuming roleARN.
+// An empty roleARN uses the process's own credentials.
+func (cc *clientCache) get(region, roleARN string) (*cloudwatch.Client, error) {
+	key := region + "|" + roleARN
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if e, ok := cc.entries[key]; ok && time.Now().Before(e.expiresAt) {
+		return e.client, nil
+	}
+
+	cfg := cc.base.Copy()
+	cfg.Region = region
+	if roleARN != "" {
+		stsClient := sts.NewFromConfig(cfg)
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, roleARN))
+	}
+
+	client := cloudwatch.NewFromConfig(cfg)
+	cc.entries[key] = cachedClient{client: client, expiresAt: time.Now().Add(cc.ttl)}
+	return client, nil
+}
+
+// run periodically evicts expired entries, so a region/role combination
+// that stops being probed doesn't pin a client (and any assumed-role
+// credentials cache) in memory for the lifetime of the process. It's meant
+// to be started with `go`. A non-positive interval (e.g. --probe-client-cache-ttl=0,
+// meaning "never reuse a client") disables the sweep instead of every
+// entry being evicted the instant it's created.
+func (cc *clientCache) run(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cc.evictExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (cc *clientCache) evictExpired() {
+	now := time.Now()
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for key, e := range cc.entries {
+		if now.After(e.expiresAt) {
+			delete(cc.entries, key)
+		}
+	}
+}
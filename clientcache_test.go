@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// TestClientCacheEvictExpired checks that evictExpired removes only entries
+// past their TTL, so keys that stop being probed don't accumulate forever.
+func TestClientCacheEvictExpired(t *testing.T) {
+	cc := newClientCache(aws.Config{}, time.Minute)
+	if _, err := cc.get("us-east-1", ""); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, err := cc.get("eu-west-1", ""); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got := len(cc.entries); got != 2 {
+		t.Fatalf("expected 2 cached clients, got %d", got)
+	}
+
+	// Force one entry to look expired without waiting out a real TTL.
+	stale := cc.entries["us-east-1|"]
+	stale.expiresAt = time.Now().Add(-time.Second)
+	cc.entries["us-east-1|"] = stale
+
+	cc.evictExpired()
+
+	if _, ok := cc.entries["us-east-1|"]; ok {
+		t.Fatalf("expected expired entry to be evicted")
+	}
+	if _, ok := cc.entries["eu-west-1|"]; !ok {
+		t.Fatalf("expected non-expired entry to survive eviction")
+	}
+}
+
+// TestClientCacheRunDisabledForNonPositiveInterval checks that run() returns
+// immediately instead of panicking when --probe-client-cache-ttl=0 ("never
+// reuse a client"), since time.NewTicker rejects non-positive durations.
+func TestClientCacheRunDisabledForNonPositiveInterval(t *testing.T) {
+	cc := newClientCache(aws.Config{}, 0)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		cc.run(0, stop)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("run(0, ...) did not return; expected it to no-op instead of starting a ticker")
+	}
+}
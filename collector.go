@@ -2,34 +2,61 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stoewer/go-strcase"
 )
 
-const batchSize = 500
+// maxQueriesPerCall is GetMetricData's limit on MetricDataQuery entries per
+// call. Since we issue one query per (metric, stat) pair, the number of
+// metrics that fit in a single batch shrinks as len(stats) grows.
+const maxQueriesPerCall = 500
 
 var (
 	// FIXME: technically it may not start with 0-9
 	prometheusMetricNameRegexp = regexp.MustCompile("[^a-zA-Z0-9_:]")
 )
 
+// Self-instrumentation: per-invocation health of Collect, so Prometheus can
+// distinguish "AWS is slow" (scrape_duration_seconds) from "AWS returned
+// nothing" (metrics_listed_total with no matching metrics_returned_total)
+// from "we're being throttled" (scrape_errors_total), all labeled by the
+// namespace/metric_name this collector instance was configured for.
+var (
+	scrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cloudwatch_exporter_scrape_duration_seconds",
+		Help: "Time taken for a single Collect invocation to list and fetch CloudWatch metrics.",
+	}, []string{"namespace", "metric_name"})
+	metricsListedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudwatch_exporter_metrics_listed_total",
+		Help: "Total number of CloudWatch metrics returned by ListMetrics.",
+	}, []string{"namespace", "metric_name"})
+	metricsReturnedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudwatch_exporter_metrics_returned_total",
+		Help: "Total number of Prometheus samples emitted from CloudWatch metrics.",
+	}, []string{"namespace", "metric_name"})
+	scrapeErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudwatch_exporter_scrape_errors_total",
+		Help: "Total number of failed ListMetrics or GetMetricData calls during Collect.",
+	}, []string{"namespace", "metric_name"})
+)
+
 type collector struct {
-	logger log.Logger
+	logger *slog.Logger
 	*reporter
 	namespace  string
 	metricName string
 	descMap    map[string]*prometheus.Desc
 	errDesc    *prometheus.Desc
+	relabeler  *relabeler
 }
 
-func newCollector(logger log.Logger, reporter *reporter, namespace, metricName string) *collector {
+func newCollector(logger *slog.Logger, reporter *reporter, namespace, metricName string, relabeler *relabeler) *collector {
 	return &collector{
 		logger:     logger,
 		reporter:   reporter,
@@ -37,6 +64,7 @@ func newCollector(logger log.Logger, reporter *reporter, namespace, metricName s
 		metricName: metricName,
 		descMap:    make(map[string]*prometheus.Desc),
 		errDesc:    prometheus.NewDesc("cloudwatch_error", "Error collecting metrics", nil, nil),
+		relabeler:  relabeler,
 	}
 }
 
@@ -47,13 +75,25 @@ func (c collector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implements Prometheus.Collector.
 func (c collector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	defer func() {
+		scrapeDuration.WithLabelValues(c.namespace, c.metricName).Observe(time.Since(start).Seconds())
+	}()
+
 	metrics, err := c.reporter.ListMetrics(c.namespace, c.metricName)
 	if err != nil {
-		level.Error(c.logger).Log("msg", "failed to list metrics", "err", err)
+		scrapeErrorsTotal.WithLabelValues(c.namespace, c.metricName).Inc()
+		c.logger.Error("failed to list metrics", "err", err)
 		ch <- prometheus.NewInvalidMetric(c.errDesc, err)
 		return
 	}
-	level.Debug(c.logger).Log("msg", "list metrics returned", "metrics", metrics)
+	c.logger.Debug("list metrics returned", "metrics", metrics)
+	metricsListedTotal.WithLabelValues(c.namespace, c.metricName).Add(float64(len(metrics)))
+
+	batchSize := maxQueriesPerCall / len(c.reporter.config.stats)
+	if batchSize < 1 {
+		batchSize = 1
+	}
 
 	// if we have less than batchSize results, we don't want to have zero entries
 	length := len(metrics)
@@ -76,29 +116,80 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 	c.collectBatch(ch, batch[:i]) // The length of the array might be bigger than the number of entries when processing more than one batch
 }
 
-func (c collector) collectMetric(ch chan<- prometheus.Metric, m *types.Metric, value float64) {
+// descForMetric returns the (possibly cached) Desc and label values for m,
+// with suffix appended to the metric name and a "stat" variable label
+// carrying the statistic (e.g. "maximum") that produced the value.
+// Dimensions are first passed through c.relabeler, so the label set (and
+// therefore the descMap key) reflects drops/renames/static labels rather
+// than the raw CloudWatch dimension names. The descMap key also includes
+// the metric's fully-qualified name, since a collector configured with
+// namespace/metricName of "*" sees multiple distinct CloudWatch metrics
+// that can share the same (post-relabel) dimension names, e.g. NetworkIn
+// and NetworkOut both keyed only by InstanceId. keep is false if a relabel
+// rule dropped the metric entirely, in which case desc and lvs are unusable.
+//
+// extraLabelNames, if given, are appended after "stat" as additional
+// variable label names; it's the caller's job to append one matching value
+// per name, in order, to the returned lvs before using it.
+func (c collector) descForMetric(m *types.Metric, stat, suffix string, extraLabelNames ...string) (desc *prometheus.Desc, lvs []string, keep bool) {
 	var (
 		namespace = strcase.SnakeCase(prometheusMetricNameRegexp.ReplaceAllString(*m.Namespace, "_"))
 		name      = strcase.SnakeCase(prometheusMetricNameRegexp.ReplaceAllString(*m.MetricName, "_"))
-
-		lns = make([]string, len(m.Dimensions))
-		lvs = make([]string, len(m.Dimensions))
 	)
-	// FIXME: do we need to sort the keys?
-	for i, d := range m.Dimensions {
-		lns[i] = *d.Name
-		lvs[i] = *d.Value
+
+	dims := make(map[string]string, len(m.Dimensions))
+	for _, d := range m.Dimensions {
+		dims[*d.Name] = *d.Value
+	}
+	relabeled, keep := c.relabeler.apply(dims)
+	if !keep {
+		return nil, nil, false
 	}
+	lns, lvs := sortedLabels(relabeled)
+	lns = append(lns, "stat")
+	lvs = append(lvs, statID(stat))
+	lns = append(lns, extraLabelNames...)
 
-	key := strings.Join(lns, " ")
-	level.Debug(c.logger).Log("msg", "Using key", "key", key)
+	fqName := namespace + "_" + name + suffix
+	key := fqName + "|" + strings.Join(lns, " ")
+	c.logger.Debug("using key", "key", key)
 	desc, ok := c.descMap[key]
 	if !ok {
-		level.Debug(c.logger).Log("msg", "Key not found, creating new decs")
-		desc = prometheus.NewDesc(namespace+"_"+name, fmt.Sprintf("Cloudwatch Metric %s/%s", *m.Namespace, *m.MetricName), lns, nil)
+		c.logger.Debug("key not found, creating new desc")
+		desc = prometheus.NewDesc(fqName, fmt.Sprintf("Cloudwatch Metric %s/%s", *m.Namespace, *m.MetricName), lns, nil)
 		c.descMap[key] = desc
 	}
-	level.Debug(c.logger).Log("msg", "Sending metric", "desc", desc.String(), "lvs", fmt.Sprintf("%+v", lvs), "value", fmt.Sprintf("%f", value))
+	return desc, lvs, true
+}
+
+// collectMetric emits a single sample for one CloudWatch datapoint.
+// distinguishByTimestamp carries the datapoint's own timestamp as a
+// "timestamp" label: exportModeAll calls this once per datapoint in a
+// single result, and without something to distinguish them they'd collide
+// as duplicate series with identical label values on the same scrape.
+// exportModeLast only ever emits the single latest datapoint, so it keeps
+// the plain (no timestamp label) series that gets updated in place every
+// scrape, instead of minting a new label combination each time.
+func (c collector) collectMetric(ch chan<- prometheus.Metric, m *types.Metric, stat string, value float64, timestamp time.Time, distinguishByTimestamp bool) {
+	var (
+		desc *prometheus.Desc
+		lvs  []string
+		keep bool
+	)
+	if distinguishByTimestamp {
+		desc, lvs, keep = c.descForMetric(m, stat, "", "timestamp")
+		if keep {
+			lvs = append(lvs, timestamp.Format(time.RFC3339Nano))
+		}
+	} else {
+		desc, lvs, keep = c.descForMetric(m, stat, "")
+	}
+	if !keep {
+		c.logger.Debug("metric dropped by relabel rule")
+		return
+	}
+	c.logger.Debug("sending metric", "desc", desc.String(), "lvs", fmt.Sprintf("%+v", lvs), "value", value)
+	metricsReturnedTotal.WithLabelValues(c.namespace, c.metricName).Inc()
 	ch <- prometheus.MustNewConstMetric(
 		desc,
 		prometheus.UntypedValue,
@@ -122,28 +213,110 @@ func (c collector) collectBatch(ch chan<- prometheus.Metric, metrics []types.Met
 	}
 	results, err := c.reporter.GetMetricsResults(metrics)
 	if err != nil {
-		level.Error(c.logger).Log("msg", "failed to get metric results", "err", err)
+		scrapeErrorsTotal.WithLabelValues(c.namespace, c.metricName).Inc()
+		c.logger.Error("failed to get metric results", "err", err)
 		ch <- prometheus.NewInvalidMetric(c.errDesc, err)
 		return
 	}
 	nr := len(results)
-	nm := len(metrics)
+	nm := len(metrics) * len(c.reporter.config.stats)
 	if nr != nm {
 		panic(fmt.Sprintf("not same length: %d != %d", nr, nm))
 	}
 	for _, result := range results {
-		// idx is index in batch
-		idx, err := strconv.Atoi((*result.Id)[1:]) // strip "n" prefix
+		idx, stat, err := parseQueryID(*result.Id)
 		if err != nil {
 			panic(err)
 		}
-		level.Debug(c.logger).Log("id", *result.Id)
+		c.logger.Debug("result", "id", *result.Id)
 		m := metrics[idx]
-		level.Debug(c.logger).Log("msg", "creating metric", "index", idx, "dimensions", sprintDims(m.Dimensions))
+		c.logger.Debug("creating metric", "index", idx, "stat", stat, "dimensions", sprintDims(m.Dimensions))
 		if len(result.Values) == 0 {
-			level.Debug(c.logger).Log("msg", "no values found")
+			c.logger.Debug("no values found")
 			continue
 		}
-		c.collectMetric(ch, &m, result.Values[0])
+		c.collectResult(ch, &m, stat, result)
+	}
+}
+
+// collectResult turns a single GetMetricData result into one or more
+// Prometheus samples, according to c.reporter.config.exportMode.
+func (c collector) collectResult(ch chan<- prometheus.Metric, m *types.Metric, stat string, result types.MetricDataResult) {
+	switch c.reporter.config.exportMode {
+	case exportModeAll:
+		for i, v := range result.Values {
+			c.collectMetric(ch, m, stat, v, result.Timestamps[i], true)
+		}
+	case exportModeHistogram:
+		c.collectHistogram(ch, m, stat, result)
+	case exportModeSummary:
+		c.collectSummary(ch, m, stat, result)
+	case exportModeLast, "":
+		fallthrough
+	default:
+		c.collectMetric(ch, m, stat, result.Values[0], result.Timestamps[0], false)
 	}
-}
\ No newline at end of file
+}
+
+// collectHistogram buckets every datapoint in result.Values over the
+// configured histogramBuckets and emits a single ConstHistogram, using the
+// most recent datapoint's CloudWatch timestamp as an exemplar.
+func (c collector) collectHistogram(ch chan<- prometheus.Metric, m *types.Metric, stat string, result types.MetricDataResult) {
+	buckets := c.reporter.config.histogramBuckets
+	counts := make(map[float64]uint64, len(buckets))
+	var sum float64
+	for _, v := range result.Values {
+		sum += v
+		for _, b := range buckets {
+			if v <= b {
+				counts[b]++
+			}
+		}
+	}
+
+	desc, lvs, keep := c.descForMetric(m, stat, "_histogram")
+	if !keep {
+		c.logger.Debug("metric dropped by relabel rule")
+		return
+	}
+	hist, err := prometheus.NewConstHistogram(desc, uint64(len(result.Values)), sum, counts, lvs...)
+	if err != nil {
+		c.logger.Error("failed to build histogram", "err", err)
+		return
+	}
+	metricsReturnedTotal.WithLabelValues(c.namespace, c.metricName).Inc()
+	if len(result.Timestamps) == 0 {
+		ch <- hist
+		return
+	}
+	histWithExemplar, err := prometheus.NewMetricWithExemplars(hist, prometheus.Exemplar{
+		Value: result.Values[0],
+		Labels: prometheus.Labels{
+			"namespace":   *m.Namespace,
+			"metric_name": *m.MetricName,
+		},
+		Timestamp: result.Timestamps[0],
+	})
+	if err != nil {
+		c.logger.Error("failed to attach exemplar", "err", err)
+		ch <- hist
+		return
+	}
+	ch <- histWithExemplar
+}
+
+// collectSummary emits a single ConstSummary covering every datapoint in
+// result.Values for the given metric.
+func (c collector) collectSummary(ch chan<- prometheus.Metric, m *types.Metric, stat string, result types.MetricDataResult) {
+	var sum float64
+	for _, v := range result.Values {
+		sum += v
+	}
+	desc, lvs, keep := c.descForMetric(m, stat, "_summary")
+	if !keep {
+		c.logger.Debug("metric dropped by relabel rule")
+		return
+	}
+	metricsReturnedTotal.WithLabelValues(c.namespace, c.metricName).Inc()
+	ch <- prometheus.MustNewConstSummary(desc, uint64(len(result.Values)), sum, nil, lvs...)
+}
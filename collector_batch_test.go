@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestCollectorMultiStatBatching checks two things at once: that a "stats"
+// label is emitted correctly per requested statistic, and that batching
+// respects GetMetricData's maxQueriesPerCall limit once each metric turns
+// into len(stats) queries instead of one.
+func TestCollectorMultiStatBatching(t *testing.T) {
+	const metricCount = 300 // with 2 stats, 300*2=600 queries: must split into >1 batch
+	metrics := make([]types.Metric, metricCount)
+	for i := range metrics {
+		metrics[i] = newTestMetric("CPUUtilization", string(rune('a'+i%26))+string(rune('0'+i/26)))
+	}
+	client := &fakeCWClient{
+		metrics: metrics,
+		resultFor: func(idx int, stat string) types.MetricDataResult {
+			return types.MetricDataResult{
+				Values:     []float64{42},
+				Timestamps: []time.Time{time.Now()},
+			}
+		},
+	}
+	rep := &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config: &reporterConfig{
+			delayDuration: 600 * time.Second,
+			rangeDuration: 600 * time.Second,
+			period:        60,
+			stats:         []string{"Maximum", "Average"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
+	c := newCollector(logger, rep, "AWS/EC2", "CPUUtilization", rl)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var (
+		got      []prometheus.Metric
+		statsSet = map[string]bool{}
+	)
+	for m := range ch {
+		got = append(got, m)
+		var dtoM dto.Metric
+		if err := m.Write(&dtoM); err != nil {
+			t.Fatalf("writing metric: %v", err)
+		}
+		for _, lp := range dtoM.GetLabel() {
+			if lp.GetName() == "stat" {
+				statsSet[lp.GetValue()] = true
+			}
+		}
+	}
+
+	if want := metricCount * 2; len(got) != want {
+		t.Fatalf("expected %d samples (metrics * stats), got %d", want, len(got))
+	}
+	if !statsSet["maximum"] || !statsSet["average"] {
+		t.Fatalf("expected both maximum and average stat labels, got %v", statsSet)
+	}
+	for i, call := range client.calls {
+		if len(call) > maxQueriesPerCall {
+			t.Fatalf("GetMetricData call %d requested %d queries, exceeding maxQueriesPerCall=%d", i, len(call), maxQueriesPerCall)
+		}
+	}
+	if len(client.calls) < 2 {
+		t.Fatalf("expected batching to split %d queries across multiple GetMetricData calls, got %d call(s)", metricCount*2, len(client.calls))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestCollectorDescMapDistinguishesMetricNames guards against descForMetric
+// caching a *prometheus.Desc (and therefore a metric's values) under the
+// wrong name. A collector configured with metricName: "*" routinely
+// processes several distinct CloudWatch metrics that share the same
+// dimension-name shape (here, both only have InstanceId), which previously
+// collided on the same descMap key and silently emitted the second metric's
+// values under the first metric's name.
+func TestCollectorDescMapDistinguishesMetricNames(t *testing.T) {
+	client := &fakeCWClient{
+		metrics: []types.Metric{
+			newTestMetric("NetworkIn", "i-1"),
+			newTestMetric("NetworkOut", "i-1"),
+		},
+		resultFor: func(idx int, stat string) types.MetricDataResult {
+			value := 111.0
+			if idx == 1 {
+				value = 222.0
+			}
+			return types.MetricDataResult{
+				Values:     []float64{value},
+				Timestamps: []time.Time{time.Now()},
+			}
+		},
+	}
+	rep := &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config: &reporterConfig{
+			delayDuration: 600 * time.Second,
+			rangeDuration: 600 * time.Second,
+			period:        60,
+			stats:         []string{"Maximum"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
+	c := newCollector(logger, rep, "AWS/EC2", "*", rl)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			values[mf.GetName()] = m.GetUntyped().GetValue()
+		}
+	}
+
+	if got, want := values["aws_ec2_network_in"], 111.0; got != want {
+		t.Fatalf("expected aws_ec2_network_in=%v, got %v (families: %v)", want, got, values)
+	}
+	if got, want := values["aws_ec2_network_out"], 222.0; got != want {
+		t.Fatalf("expected aws_ec2_network_out=%v, got %v (families: %v)", want, got, values)
+	}
+}
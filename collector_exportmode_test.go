@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeCWClient is a minimal ListMetricsAPIClient/GetMetricDataAPIClient that
+// hands back a fixed set of metrics and, for each MetricDataQuery, a result
+// built by resultFor. It lets us exercise collector/reporter logic without
+// the mock package's fuller CloudWatch simulation.
+type fakeCWClient struct {
+	metrics   []types.Metric
+	resultFor func(idx int, stat string) types.MetricDataResult
+	calls     [][]types.MetricDataQuery
+}
+
+func (f *fakeCWClient) ListMetrics(ctx context.Context, params *cloudwatch.ListMetricsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListMetricsOutput, error) {
+	return &cloudwatch.ListMetricsOutput{Metrics: f.metrics}, nil
+}
+
+func (f *fakeCWClient) GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	f.calls = append(f.calls, params.MetricDataQueries)
+	results := make([]types.MetricDataResult, len(params.MetricDataQueries))
+	for i, q := range params.MetricDataQueries {
+		idx, stat, err := parseQueryID(*q.Id)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = f.resultFor(idx, stat)
+		results[i].Id = q.Id
+	}
+	return &cloudwatch.GetMetricDataOutput{MetricDataResults: results}, nil
+}
+
+func newTestMetric(name string, instance string) types.Metric {
+	return types.Metric{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String(name),
+		Dimensions: []types.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(instance)}},
+	}
+}
+
+// TestCollectorExportModeAllDistinctDatapoints ensures export-mode=all
+// produces one distinct series per CloudWatch datapoint instead of
+// colliding on identical label values, which previously made
+// registry.Gather() fail with a duplicate-metric error.
+func TestCollectorExportModeAllDistinctDatapoints(t *testing.T) {
+	base := time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC)
+	client := &fakeCWClient{
+		metrics: []types.Metric{newTestMetric("CPUUtilization", "i-1")},
+		resultFor: func(idx int, stat string) types.MetricDataResult {
+			return types.MetricDataResult{
+				Values: []float64{1, 2, 3},
+				Timestamps: []time.Time{
+					base,
+					base.Add(time.Minute),
+					base.Add(2 * time.Minute),
+				},
+			}
+		},
+	}
+	rep := &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config: &reporterConfig{
+			delayDuration: 600 * time.Second,
+			rangeDuration: 600 * time.Second,
+			period:        60,
+			stats:         []string{"Maximum"},
+			exportMode:    exportModeAll,
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
+	c := newCollector(logger, rep, "AWS/EC2", "CPUUtilization", rl)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather failed (likely duplicate series): %v", err)
+	}
+
+	var samples int
+	for _, mf := range mfs {
+		samples += len(mf.GetMetric())
+	}
+	if samples != 3 {
+		t.Fatalf("expected 3 samples (one per datapoint), got %d", samples)
+	}
+}
+
+// TestCollectorExportModeLastStableLabelsAcrossScrapes ensures the default
+// export mode keeps a fixed label set across scrapes, so the same series
+// gets updated in place as its CloudWatch timestamp moves forward, instead
+// of minting a new label combination (and a new time series) every scrape.
+func TestCollectorExportModeLastStableLabelsAcrossScrapes(t *testing.T) {
+	now := time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC)
+	client := &fakeCWClient{
+		metrics: []types.Metric{newTestMetric("CPUUtilization", "i-1")},
+		resultFor: func(idx int, stat string) types.MetricDataResult {
+			return types.MetricDataResult{
+				Values:     []float64{1},
+				Timestamps: []time.Time{now},
+			}
+		},
+	}
+	rep := &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config: &reporterConfig{
+			delayDuration: 600 * time.Second,
+			rangeDuration: 600 * time.Second,
+			period:        60,
+			stats:         []string{"Maximum"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
+	c := newCollector(logger, rep, "AWS/EC2", "CPUUtilization", rl)
+
+	var labelSets []string
+	for scrape := 0; scrape < 2; scrape++ {
+		now = now.Add(time.Minute) // each scrape's datapoint timestamp moves forward
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("scrape %d: gather failed: %v", scrape, err)
+		}
+		var samples int
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				samples++
+				var lbls string
+				for _, lp := range m.GetLabel() {
+					lbls += lp.GetName() + "=" + lp.GetValue() + ","
+				}
+				labelSets = append(labelSets, lbls)
+			}
+		}
+		if samples != 1 {
+			t.Fatalf("scrape %d: expected 1 sample, got %d", scrape, samples)
+		}
+	}
+
+	if labelSets[0] != labelSets[1] {
+		t.Fatalf("expected the same label set across scrapes, got %q then %q", labelSets[0], labelSets[1])
+	}
+}
+
+// TestCollectorExportModeHistogram exercises collectHistogram end to end,
+// including the exemplar attached to it, which previously didn't compile
+// (NewMetricWithExemplars takes Exemplar structs, not a bare Labels map).
+func TestCollectorExportModeHistogram(t *testing.T) {
+	base := time.Date(2026, 7, 26, 12, 0, 0, 0, time.UTC)
+	client := &fakeCWClient{
+		metrics: []types.Metric{newTestMetric("CPUUtilization", "i-1")},
+		resultFor: func(idx int, stat string) types.MetricDataResult {
+			return types.MetricDataResult{
+				Values: []float64{10, 60, 90},
+				Timestamps: []time.Time{
+					base,
+					base.Add(time.Minute),
+					base.Add(2 * time.Minute),
+				},
+			}
+		},
+	}
+	rep := &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config: &reporterConfig{
+			delayDuration:    600 * time.Second,
+			rangeDuration:    600 * time.Second,
+			period:           60,
+			stats:            []string{"Maximum"},
+			exportMode:       exportModeHistogram,
+			histogramBuckets: []float64{25, 75, 100},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
+	c := newCollector(logger, rep, "AWS/EC2", "CPUUtilization", rl)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+
+	var hist *dto.Histogram
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			if m.GetHistogram() != nil {
+				hist = m.GetHistogram()
+			}
+		}
+	}
+	if hist == nil {
+		t.Fatalf("expected a histogram metric, got none among %d families", len(mfs))
+	}
+	if got, want := hist.GetSampleCount(), uint64(3); got != want {
+		t.Fatalf("expected sample count %d, got %d", want, got)
+	}
+	if got, want := hist.GetSampleSum(), float64(10+60+90); got != want {
+		t.Fatalf("expected sample sum %v, got %v", want, got)
+	}
+}
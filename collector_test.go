@@ -1,13 +1,13 @@
 package main
 
 import (
+	"log/slog"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/discordianfish/cloudwatch-exporter/mock"
 
-	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -30,10 +30,14 @@ func TestCollector(t *testing.T) {
 			delayDuration: 600 * time.Second,
 			rangeDuration: 600 * time.Second,
 			period:        60,
-			stat:          "Maximum",
+			stats:         []string{"Maximum"},
 		},
 	}
-	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout))
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	rl, err := newRelabeler("")
+	if err != nil {
+		t.Fatalf("failed to build no-op relabeler: %v", err)
+	}
 	for _, tc := range []struct {
 		namespace  string
 		metricName string
@@ -45,7 +49,7 @@ func TestCollector(t *testing.T) {
 		{"AWS/EBS", "*", count},
 		{"*", "*", count * (len(metricNames) + 1)}, // Also returns the EBS metric
 	} {
-		collector := newCollector(logger, reporter, tc.namespace, tc.metricName)
+		collector := newCollector(logger, reporter, tc.namespace, tc.metricName, rl)
 
 		metrics := []prometheus.Metric{}
 
@@ -63,4 +67,4 @@ func TestCollector(t *testing.T) {
 			t.Fatalf("Expected %d but got %d results", tc.count, c)
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/common/promslog/flag"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	listenAddress  = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9106").String()
+	metricsPath    = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+	region         = kingpin.Flag("region", "AWS region to query CloudWatch in for the statically-configured target. Leave unset, along with --namespace/--metric-name, to run in /probe-only multi-tenant mode.").String()
+	namespace      = kingpin.Flag("namespace", "CloudWatch namespace to query, or \"*\" for all.").String()
+	metricName     = kingpin.Flag("metric-name", "CloudWatch metric name to query, or \"*\" for all.").String()
+	stats          = kingpin.Flag("stats", "Comma-separated CloudWatch statistics to request (e.g. Maximum,Average,p95). Each becomes its own \"stat\" label.").Default("Maximum").String()
+	period         = kingpin.Flag("period", "CloudWatch period, in seconds, to request.").Default("60").Int32()
+	rangeDuration  = kingpin.Flag("range-duration", "How far back each scrape's GetMetricData window extends.").Default("10m").Duration()
+	delayDuration  = kingpin.Flag("delay-duration", "How far behind \"now\" the GetMetricData window ends, to allow for CloudWatch's own reporting lag.").Default("10m").Duration()
+	exportModeFl   = kingpin.Flag("export-mode", "How to turn a metric's datapoints into Prometheus samples: last, all, histogram or summary.").Default("last").Enum("last", "all", "histogram", "summary")
+	histBuckets    = kingpin.Flag("histogram-buckets", "Comma-separated upper bounds used when --export-mode=histogram.").Default("").String()
+	relabelPath    = kingpin.Flag("relabel-config", "Path to a YAML file of static_labels/relabel_configs applied to every metric's dimensions. Reloaded on SIGHUP.").Default("").String()
+	refreshIntv    = kingpin.Flag("refresh-interval", "How often to poll CloudWatch in the background, independent of scrape interval. Scrapes are served from the most recent refresh.").Default("5m").Duration()
+	clientCacheTTL = kingpin.Flag("probe-client-cache-ttl", "How long to reuse a CloudWatch client (and any assumed role credentials) built for a /probe region+role_arn.").Default("15m").Duration()
+)
+
+func main() {
+	promslogConfig := &promslog.Config{}
+	flag.AddFlags(kingpin.CommandLine, promslogConfig)
+	kingpin.Version(version.Print("cloudwatch_exporter"))
+	kingpin.HelpFlag.Short('h')
+	kingpin.Parse()
+
+	logger := promslog.New(promslogConfig)
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithLogger(awsLogAdapter{logger}),
+		awsconfig.WithClientLogMode(aws.LogRetries),
+	)
+	if err != nil {
+		logger.Error("failed to load AWS config", "err", err)
+		os.Exit(1)
+	}
+
+	buckets, err := parseHistogramBuckets(*histBuckets)
+	if err != nil {
+		logger.Error("invalid --histogram-buckets", "err", err)
+		os.Exit(1)
+	}
+	baseReporterConfig := reporterConfig{
+		delayDuration:    *delayDuration,
+		rangeDuration:    *rangeDuration,
+		period:           *period,
+		stats:            strings.Split(*stats, ","),
+		exportMode:       exportMode(*exportModeFl),
+		histogramBuckets: buckets,
+	}
+
+	rl, err := newRelabeler(*relabelPath)
+	if err != nil {
+		logger.Error("failed to load relabel config", "err", err)
+		os.Exit(1)
+	}
+	if *relabelPath != "" {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		go func() {
+			for range sighup {
+				if err := rl.reload(); err != nil {
+					logger.Error("failed to reload relabel config", "err", err)
+					continue
+				}
+				logger.Info("reloaded relabel config", "path", *relabelPath)
+			}
+		}()
+	}
+
+	selfRegistry := prometheus.NewRegistry()
+	selfRegistry.MustRegister(
+		apiCallsTotal,
+		lastSuccessfulRefresh,
+		scrapeDuration,
+		metricsListedTotal,
+		metricsReturnedTotal,
+		scrapeErrorsTotal,
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{Namespace: "cloudwatch_exporter"}),
+		collectors.NewGoCollector(),
+	)
+
+	// A region/namespace/metric-name set on the command line keeps working
+	// as a single statically-configured target, refreshed in the
+	// background and served from cloudwatch_exporter's own /metrics.
+	if *region != "" && *namespace != "" && *metricName != "" {
+		staticCfg := baseReporterConfig
+		regionCfg := awsCfg.Copy()
+		regionCfg.Region = *region
+		rep := newReporter(context.Background(), cloudwatch.NewFromConfig(regionCfg), &staticCfg)
+		c := newCollector(logger, rep, *namespace, *metricName, rl)
+		selfRegistry.MustRegister(c)
+
+		gatherer := newCachingGatherer(selfRegistry, logger)
+		stop := make(chan struct{})
+		go gatherer.run(*refreshIntv, stop)
+		http.Handle(*metricsPath, promhttp.HandlerForTransactional(gatherer, promhttp.HandlerOpts{}))
+	} else {
+		http.Handle(*metricsPath, promhttp.HandlerFor(selfRegistry, promhttp.HandlerOpts{}))
+	}
+
+	clients := newClientCache(awsCfg, *clientCacheTTL)
+	clientCacheStop := make(chan struct{})
+	go clients.run(*clientCacheTTL, clientCacheStop)
+	http.Handle("/probe", newProbeHandler(logger, clients, rl, baseReporterConfig))
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html>
+			<head><title>CloudWatch Exporter</title></head>
+			<body>
+			<h1>CloudWatch Exporter</h1>
+			<p><a href="%s">Metrics</a></p>
+			<p><a href="/probe?region=us-east-1&amp;namespace=AWS/EC2&amp;metric_name=CPUUtilization">Example probe</a></p>
+			</body>
+			</html>`, *metricsPath)
+	})
+
+	logger.Info("listening", "address", *listenAddress)
+	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+		logger.Error("failed to start server", "err", err)
+		os.Exit(1)
+	}
+}
+
+func parseHistogramBuckets(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	buckets := make([]float64, len(parts))
+	for i, p := range parts {
+		var v float64
+		if _, err := fmt.Sscanf(strings.TrimSpace(p), "%g", &v); err != nil {
+			return nil, fmt.Errorf("parsing bucket %q: %w", p, err)
+		}
+		buckets[i] = v
+	}
+	return buckets, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newProbeHandler returns a blackbox-exporter-style handler: each request
+// picks its own region/namespace/metric_name (and optional role_arn) via
+// query parameters, builds a one-shot collector against a cached
+// per-region/role CloudWatch client, and serves just that scrape. This
+// lets one exporter process cover many accounts/regions/namespaces via
+// Prometheus relabel_configs on __address__, instead of one container per
+// (account, region, namespace) tuple.
+//
+// defaults supplies everything Collect needs besides namespace/metricName
+// (stats, period, export mode, ranges); every probe shares them.
+func newProbeHandler(logger *slog.Logger, cache *clientCache, rl *relabeler, defaults reporterConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		region := q.Get("region")
+		namespace := q.Get("namespace")
+		metricName := q.Get("metric_name")
+		roleARN := q.Get("role_arn")
+
+		if region == "" || namespace == "" || metricName == "" {
+			http.Error(w, "region, namespace and metric_name query parameters are required", http.StatusBadRequest)
+			return
+		}
+
+		client, err := cache.get(region, roleARN)
+		if err != nil {
+			logger.Error("failed to build CloudWatch client", "err", err, "region", region, "role_arn", roleARN)
+			http.Error(w, fmt.Sprintf("building CloudWatch client: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		cfg := defaults // copy: per-probe reporter, shared config
+		rep := newReporter(r.Context(), client, &cfg)
+		c := newCollector(logger, rep, namespace, metricName, rl)
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
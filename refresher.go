@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// lastSuccessfulRefresh records when the background refresher last
+// completed a scrape of CloudWatch successfully, so operators can alert on
+// a stale cache independent of how often Prometheus itself scrapes us.
+var lastSuccessfulRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "cloudwatch_last_successful_refresh_timestamp_seconds",
+	Help: "Unix timestamp of the last successful background refresh of CloudWatch data.",
+})
+
+// cachingGatherer polls an underlying prometheus.Gatherer on a fixed
+// interval and serves whatever it last fetched, so that Prometheus scrapes
+// are O(1) memory copies instead of triggering a fresh round of CloudWatch
+// API calls every time. It implements prometheus.TransactionalGatherer.
+type cachingGatherer struct {
+	inner    prometheus.Gatherer
+	logger   *slog.Logger
+	snapshot atomic.Pointer[[]*dto.MetricFamily]
+}
+
+func newCachingGatherer(inner prometheus.Gatherer, logger *slog.Logger) *cachingGatherer {
+	return &cachingGatherer{inner: inner, logger: logger}
+}
+
+// run refreshes the snapshot immediately and then every interval, until
+// the passed channel is closed. It's meant to be started with `go`.
+func (g *cachingGatherer) run(interval time.Duration, stop <-chan struct{}) {
+	g.refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.refresh()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (g *cachingGatherer) refresh() {
+	mfs, err := g.inner.Gather()
+	if err != nil {
+		g.logger.Error("failed to refresh CloudWatch snapshot", "err", err)
+		return
+	}
+	g.snapshot.Store(&mfs)
+	lastSuccessfulRefresh.Set(float64(time.Now().Unix()))
+}
+
+// Gather implements prometheus.TransactionalGatherer.
+func (g *cachingGatherer) Gather() ([]*dto.MetricFamily, func(), error) {
+	mfs := g.snapshot.Load()
+	if mfs == nil {
+		return nil, func() {}, nil
+	}
+	return *mfs, func() {}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// countingGatherer returns an increasing counter value on each Gather call,
+// so tests can tell which refresh a snapshot came from.
+type countingGatherer struct {
+	n int
+}
+
+func (g *countingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.n++
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "refresh_count"})
+	gauge.Set(float64(g.n))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(gauge)
+	return reg.Gather()
+}
+
+func refreshCount(t *testing.T, g *cachingGatherer) float64 {
+	t.Helper()
+	mfs, _, err := g.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	if len(mfs) != 1 || len(mfs[0].GetMetric()) != 1 {
+		t.Fatalf("expected exactly one metric, got %v", mfs)
+	}
+	return mfs[0].GetMetric()[0].GetGauge().GetValue()
+}
+
+// TestCachingGathererServesStaleSnapshotBetweenRefreshes checks that
+// Gather() keeps returning the last successfully fetched snapshot instead
+// of blocking on (or triggering) a fresh poll of the inner gatherer.
+func TestCachingGathererServesStaleSnapshotBetweenRefreshes(t *testing.T) {
+	inner := &countingGatherer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	g := newCachingGatherer(inner, logger)
+
+	if mfs, _, err := g.Gather(); err != nil || mfs != nil {
+		t.Fatalf("expected no snapshot before the first refresh, got mfs=%v err=%v", mfs, err)
+	}
+
+	g.refresh()
+	first := refreshCount(t, g)
+	if first != 1 {
+		t.Fatalf("expected first refresh to produce count 1, got %v", first)
+	}
+
+	// Repeated Gather() calls without an intervening refresh must keep
+	// returning the same snapshot rather than polling inner again.
+	for i := 0; i < 3; i++ {
+		if got := refreshCount(t, g); got != first {
+			t.Fatalf("expected stale snapshot %v, got %v", first, got)
+		}
+	}
+	if inner.n != 1 {
+		t.Fatalf("expected inner gatherer to be polled exactly once, got %d", inner.n)
+	}
+
+	g.refresh()
+	second := refreshCount(t, g)
+	if second != 2 {
+		t.Fatalf("expected refresh to advance the snapshot to count 2, got %v", second)
+	}
+}
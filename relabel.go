@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// relabelAction mirrors the subset of Prometheus's relabel_configs actions
+// that make sense for a flat dimension map rather than a label set with a
+// metric name: we have no "__name__" to rewrite and no target instance to
+// scrape, just dimensions to drop, rename or fold together.
+type relabelAction string
+
+const (
+	relabelReplace   relabelAction = "replace"
+	relabelKeep      relabelAction = "keep"
+	relabelDrop      relabelAction = "drop"
+	relabelLabelDrop relabelAction = "labeldrop"
+	relabelLabelKeep relabelAction = "labelkeep"
+)
+
+// relabelRule is one entry of the relabel_configs list. It's intentionally
+// close to Prometheus's own relabel config so operators familiar with
+// scrape-side relabeling don't have to learn a second dialect.
+type relabelRule struct {
+	SourceLabels []string      `yaml:"source_labels"`
+	Separator    string        `yaml:"separator"`
+	TargetLabel  string        `yaml:"target_label"`
+	Regex        string        `yaml:"regex"`
+	Replacement  string        `yaml:"replacement"`
+	Action       relabelAction `yaml:"action"`
+
+	regex *regexp.Regexp
+}
+
+// relabelConfig is the top-level YAML document: a static set of labels
+// applied to every metric (e.g. account_id, region) followed by the rule
+// pipeline.
+type relabelConfig struct {
+	StaticLabels   map[string]string `yaml:"static_labels"`
+	RelabelConfigs []relabelRule     `yaml:"relabel_configs"`
+}
+
+func loadRelabelConfig(path string) (*relabelConfig, error) {
+	if path == "" {
+		return &relabelConfig{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading relabel config: %w", err)
+	}
+	var cfg relabelConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing relabel config: %w", err)
+	}
+	for i, rule := range cfg.RelabelConfigs {
+		sep := rule.Separator
+		if sep == "" {
+			sep = ";"
+		}
+		cfg.RelabelConfigs[i].Separator = sep
+		pattern := rule.Regex
+		if pattern == "" {
+			pattern = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel_configs[%d]: invalid regex %q: %w", i, rule.Regex, err)
+		}
+		cfg.RelabelConfigs[i].regex = re
+	}
+	return &cfg, nil
+}
+
+// apply runs dims (CloudWatch dimension name -> value) through the static
+// labels and rule pipeline and returns the resulting label set, or
+// keep=false if a rule dropped the metric entirely.
+func (c *relabelConfig) apply(dims map[string]string) (out map[string]string, keep bool) {
+	out = make(map[string]string, len(dims)+len(c.StaticLabels))
+	for k, v := range dims {
+		out[k] = v
+	}
+	for k, v := range c.StaticLabels {
+		out[k] = v
+	}
+
+	for _, rule := range c.RelabelConfigs {
+		values := make([]string, len(rule.SourceLabels))
+		for i, l := range rule.SourceLabels {
+			values[i] = out[l]
+		}
+		joined := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case relabelKeep:
+			if !rule.regex.MatchString(joined) {
+				return nil, false
+			}
+		case relabelDrop:
+			if rule.regex.MatchString(joined) {
+				return nil, false
+			}
+		case relabelLabelDrop:
+			re := rule.regex
+			for k := range out {
+				if re.MatchString(k) {
+					delete(out, k)
+				}
+			}
+		case relabelLabelKeep:
+			re := rule.regex
+			for k := range out {
+				if !re.MatchString(k) {
+					delete(out, k)
+				}
+			}
+		case relabelReplace, "":
+			if !rule.regex.MatchString(joined) {
+				continue
+			}
+			target := rule.TargetLabel
+			if target == "" {
+				continue
+			}
+			out[target] = rule.regex.ReplaceAllString(joined, rule.Replacement)
+		}
+	}
+	return out, true
+}
+
+// sortedLabels returns the names and values of labels, sorted by name so
+// that the same dimension set always produces the same Desc key and label
+// order regardless of map iteration order.
+func sortedLabels(labels map[string]string) (names, values []string) {
+	names = make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	values = make([]string, len(names))
+	for i, k := range names {
+		values[i] = labels[k]
+	}
+	return names, values
+}
+
+// relabeler is the hot-reloadable handle a collector consults. The
+// underlying *relabelConfig is swapped atomically on SIGHUP so in-flight
+// scrapes never see a half-updated config.
+type relabeler struct {
+	path string
+	cur  atomic.Pointer[relabelConfig]
+}
+
+func newRelabeler(path string) (*relabeler, error) {
+	cfg, err := loadRelabelConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &relabeler{path: path}
+	r.cur.Store(cfg)
+	return r, nil
+}
+
+// reload re-reads the config file from disk and swaps it in. Callers
+// (typically the SIGHUP handler in main) should log the outcome.
+func (r *relabeler) reload() error {
+	cfg, err := loadRelabelConfig(r.path)
+	if err != nil {
+		return err
+	}
+	r.cur.Store(cfg)
+	return nil
+}
+
+func (r *relabeler) apply(dims map[string]string) (map[string]string, bool) {
+	return r.cur.Load().apply(dims)
+}
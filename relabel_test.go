@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRelabelConfigApply(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "relabel-*.yaml")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	_, err = f.WriteString(`
+static_labels:
+  region: us-east-1
+relabel_configs:
+  - source_labels: [InstanceId]
+    regex: i-excluded
+    action: drop
+  - source_labels: [AutoScalingGroupName]
+    target_label: asg
+    regex: (.+)
+    replacement: $1
+  - action: labeldrop
+    regex: AutoScalingGroupName
+`)
+	if err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("closing temp file: %v", err)
+	}
+
+	cfg, err := loadRelabelConfig(f.Name())
+	if err != nil {
+		t.Fatalf("parsing relabel config: %v", err)
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		_, keep := cfg.apply(map[string]string{"InstanceId": "i-excluded"})
+		if keep {
+			t.Fatalf("expected metric to be dropped")
+		}
+	})
+
+	t.Run("keep and rename", func(t *testing.T) {
+		out, keep := cfg.apply(map[string]string{
+			"InstanceId":           "i-abc123",
+			"AutoScalingGroupName": "web-servers",
+		})
+		if !keep {
+			t.Fatalf("expected metric to be kept")
+		}
+		if out["asg"] != "web-servers" {
+			t.Fatalf("expected asg=web-servers, got %v", out)
+		}
+		if _, ok := out["AutoScalingGroupName"]; ok {
+			t.Fatalf("expected AutoScalingGroupName to be dropped by labeldrop, got %v", out)
+		}
+		if out["region"] != "us-east-1" {
+			t.Fatalf("expected static label region=us-east-1, got %v", out)
+		}
+		if out["InstanceId"] != "i-abc123" {
+			t.Fatalf("expected InstanceId to pass through untouched, got %v", out)
+		}
+	})
+}
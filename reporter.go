@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiCallsTotal counts calls made to each CloudWatch API, labeled by API
+// name, so operators can watch quota burn in Prometheus itself rather than
+// only finding out once AWS starts throttling.
+var apiCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloudwatch_api_calls_total",
+	Help: "Total number of calls made to each CloudWatch API.",
+}, []string{"api"})
+
+// ListMetricsAPIClient is the subset of the CloudWatch SDK client used to
+// discover metrics. It is satisfied by *cloudwatch.Client and by the mock
+// client used in tests.
+type ListMetricsAPIClient interface {
+	ListMetrics(ctx context.Context, params *cloudwatch.ListMetricsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListMetricsOutput, error)
+}
+
+// GetMetricDataAPIClient is the subset of the CloudWatch SDK client used to
+// fetch datapoints for previously discovered metrics.
+type GetMetricDataAPIClient interface {
+	GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error)
+}
+
+// exportMode controls how the datapoints returned for a single metric query
+// are turned into Prometheus samples.
+type exportMode string
+
+const (
+	exportModeLast      exportMode = "last"
+	exportModeAll       exportMode = "all"
+	exportModeHistogram exportMode = "histogram"
+	exportModeSummary   exportMode = "summary"
+)
+
+type reporterConfig struct {
+	delayDuration time.Duration
+	rangeDuration time.Duration
+	period        int32
+	// stats is the set of CloudWatch statistics (e.g. "Maximum", "Average",
+	// or extended statistics like "p95") requested for every metric. Each
+	// entry becomes its own MetricDataQuery and its own "stat" label on the
+	// exported series, so a single scrape can carry several stats for the
+	// same underlying metric without multiplying API calls.
+	stats      []string
+	exportMode exportMode
+	// histogramBuckets are the upper bounds used when exportMode is
+	// exportModeHistogram. They're only consulted in that mode.
+	histogramBuckets []float64
+}
+
+// statIDRegexp matches the characters GetMetricData forbids in query ids.
+var statIDRegexp = regexp.MustCompile("[^a-z0-9]")
+
+// statID turns a CloudWatch statistic name into the lowercase,
+// alphanumeric-only form used both as part of a MetricDataQuery id and as
+// the "stat" label value on the resulting series, e.g. "p95" -> "p95",
+// "Average" -> "average".
+func statID(stat string) string {
+	return statIDRegexp.ReplaceAllString(strings.ToLower(stat), "")
+}
+
+// queryID encodes the metric's batch index and requested statistic into a
+// MetricDataQuery id of the form "n<idx>_<stat>", so results can be mapped
+// back to a (metric, stat) pair without a side channel.
+func queryID(idx int, stat string) string {
+	return fmt.Sprintf("n%d_%s", idx, statID(stat))
+}
+
+// parseQueryID is the inverse of queryID.
+func parseQueryID(id string) (idx int, stat string, err error) {
+	parts := strings.SplitN(id, "_", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("malformed query id %q", id)
+	}
+	if _, err = fmt.Sscanf(parts[0], "n%d", &idx); err != nil {
+		return 0, "", fmt.Errorf("malformed query id %q: %w", id, err)
+	}
+	return idx, parts[1], nil
+}
+
+// reporter talks to CloudWatch on behalf of one or more collectors. It's
+// intentionally dumb: it knows how to turn a namespace/metric name into a
+// list of types.Metric and how to fetch datapoints for a batch of metrics,
+// nothing else.
+type reporter struct {
+	ListMetricsAPIClient
+	GetMetricDataAPIClient
+	config *reporterConfig
+	// ctx is the context passed to every CloudWatch call this reporter
+	// makes. /probe builds one reporter per incoming request and passes
+	// r.Context(), so a client disconnect cancels the in-flight CloudWatch
+	// calls; the statically-configured target has no per-request context
+	// to inherit and passes context.Background() instead.
+	ctx context.Context
+}
+
+func newReporter(ctx context.Context, client *cloudwatch.Client, config *reporterConfig) *reporter {
+	return &reporter{
+		ListMetricsAPIClient:   client,
+		GetMetricDataAPIClient: client,
+		config:                 config,
+		ctx:                    ctx,
+	}
+}
+
+// reporterCtx returns r.ctx, falling back to context.Background() for
+// reporters built by hand (e.g. in tests) without going through newReporter.
+func (r *reporter) reporterCtx() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// ListMetrics returns every CloudWatch metric matching namespace/metricName.
+// Either may be "*" to match anything, mirroring the CloudWatch console's
+// "browse metrics" behaviour.
+func (r *reporter) ListMetrics(namespace, metricName string) ([]types.Metric, error) {
+	input := &cloudwatch.ListMetricsInput{}
+	if namespace != "*" {
+		input.Namespace = aws.String(namespace)
+	}
+	if metricName != "*" {
+		input.MetricName = aws.String(metricName)
+	}
+
+	var metrics []types.Metric
+	paginator := cloudwatch.NewListMetricsPaginator(r.ListMetricsAPIClient, input)
+	for paginator.HasMorePages() {
+		apiCallsTotal.WithLabelValues("ListMetrics").Inc()
+		page, err := paginator.NextPage(r.reporterCtx())
+		if err != nil {
+			return nil, fmt.Errorf("listing metrics: %w", err)
+		}
+		metrics = append(metrics, page.Metrics...)
+	}
+	return metrics, nil
+}
+
+// GetMetricsResults fetches datapoints for a batch of metrics (at most
+// batchSize), one MetricDataQuery per (metric, stat) pair in
+// r.config.stats. The result slice's Id encodes both the metric's index and
+// its stat as "n<idx>_<stat>" (see queryID/parseQueryID) so callers can map
+// results back to the metric and the stat that produced them.
+func (r *reporter) GetMetricsResults(metrics []types.Metric) ([]types.MetricDataResult, error) {
+	now := time.Now()
+	queries := make([]types.MetricDataQuery, 0, len(metrics)*len(r.config.stats))
+	for i, m := range metrics {
+		for _, stat := range r.config.stats {
+			queries = append(queries, types.MetricDataQuery{
+				Id: aws.String(queryID(i, stat)),
+				MetricStat: &types.MetricStat{
+					Metric: &m,
+					Period: aws.Int32(r.config.period),
+					Stat:   aws.String(stat),
+				},
+			})
+		}
+	}
+
+	apiCallsTotal.WithLabelValues("GetMetricData").Inc()
+	out, err := r.GetMetricDataAPIClient.GetMetricData(r.reporterCtx(), &cloudwatch.GetMetricDataInput{
+		StartTime:         aws.Time(now.Add(-r.config.delayDuration - r.config.rangeDuration)),
+		EndTime:           aws.Time(now.Add(-r.config.delayDuration)),
+		MetricDataQueries: queries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting metric data: %w", err)
+	}
+	return out.MetricDataResults, nil
+}